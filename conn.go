@@ -0,0 +1,127 @@
+package conntrack
+
+import (
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/ti-mo/netfilter"
+)
+
+// Conn represents a Netlink connection to the Conntrack subsystem
+// and exposes the actions available to userspace.
+type Conn struct {
+	conn *netlink.Conn
+}
+
+// Dial opens a new Netlink connection to the Conntrack subsystem and
+// returns a Conn wrapping it. config is passed to the underlying
+// netlink.Dial call and may be nil.
+func Dial(config *netlink.Config) (*Conn, error) {
+
+	c, err := netlink.Dial(unix.NETLINK_NETFILTER, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{conn: c}, nil
+}
+
+// Close closes the underlying Netlink connection.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// query marshals a netfilter.Header and a list of netfilter.Attributes into
+// a single Netlink request and executes it against the kernel, returning
+// the response messages.
+func (c *Conn) query(nfh netfilter.Header, attrs []netfilter.Attribute) ([]netlink.Message, error) {
+
+	data, err := netfilter.MarshalNetlink(nfh, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	req := netlink.Message{
+		Header: netlink.Header{
+			Type:  netlink.HeaderType(uint16(nfh.SubsystemID)<<8 | uint16(nfh.MessageType)),
+			Flags: nfh.Flags,
+		},
+		Data: data,
+	}
+
+	return c.conn.Execute(req)
+}
+
+// family returns the protocol family of a Tuple's source address, used to
+// populate the netfilter.Header of requests built around it.
+func (t Tuple) family() netfilter.ProtoFamily {
+	if t.IP.SourceAddress.To4() == nil {
+		return netfilter.ProtoIPv6
+	}
+	return netfilter.ProtoIPv4
+}
+
+// family returns the protocol family a Flow's original tuple belongs to,
+// used to populate the netfilter.Header of requests built from f. Returns
+// netfilter.ProtoUnspec if f carries no TupleOrig, as is the case for an
+// Update looking up its entry by ID alone.
+func (f Flow) family() netfilter.ProtoFamily {
+	if !f.TupleOrig.Filled() {
+		return netfilter.ProtoUnspec
+	}
+	return f.TupleOrig.family()
+}
+
+// createFlags and updateFlags are the Netlink flags Create and Update put on
+// their request header. createFlags carries NLM_F_EXCL so the kernel rejects
+// the request with EEXIST if a matching entry already exists; updateFlags
+// omits it so an existing entry is replaced instead.
+var (
+	createFlags = netlink.Request | netlink.Create | netlink.Excl | netlink.Acknowledge
+	updateFlags = netlink.Request | netlink.Replace | netlink.Acknowledge
+)
+
+// Create sends a request to the kernel to create a new Conntrack entry from
+// the given Flow. NLM_F_CREATE and NLM_F_EXCL are set on the request, so the
+// kernel rejects it with EEXIST if a matching entry already exists.
+//
+// f must have both TupleOrig and TupleReply filled in.
+func (c *Conn) Create(f Flow) error {
+
+	attrs, err := f.marshalCreate()
+	if err != nil {
+		return err
+	}
+
+	nfh := netfilter.Header{
+		Family:      f.family(),
+		MessageType: netfilter.MessageType(IPCTNL_MSG_CT_NEW),
+		Flags:       createFlags,
+	}
+
+	_, err = c.query(nfh, attrs)
+
+	return err
+}
+
+// Update sends a request to the kernel to update an existing Conntrack
+// entry with the values set on f. f must carry either an ID or a filled
+// TupleOrig so the kernel can locate the entry to modify; unlike Create, it
+// does not require both tuples to be present.
+func (c *Conn) Update(f Flow) error {
+
+	attrs, err := f.marshalUpdate()
+	if err != nil {
+		return err
+	}
+
+	nfh := netfilter.Header{
+		Family:      f.family(),
+		MessageType: netfilter.MessageType(IPCTNL_MSG_CT_NEW),
+		Flags:       updateFlags,
+	}
+
+	_, err = c.query(nfh, attrs)
+
+	return err
+}
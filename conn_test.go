@@ -0,0 +1,40 @@
+package conntrack
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mdlayher/netlink"
+	"github.com/ti-mo/netfilter"
+)
+
+func TestCreateUpdateFlags(t *testing.T) {
+	if createFlags&netlink.Excl == 0 {
+		t.Fatal("createFlags must carry NLM_F_EXCL so Create never silently overwrites an existing entry")
+	}
+
+	if updateFlags&netlink.Excl != 0 {
+		t.Fatal("updateFlags must not carry NLM_F_EXCL, or Update would fail against an existing entry")
+	}
+
+	if createFlags&netlink.Create == 0 {
+		t.Fatal("createFlags must carry NLM_F_CREATE")
+	}
+}
+
+func TestFlowFamilyIDOnly(t *testing.T) {
+	var f Flow
+	f.ID = 1
+
+	if got := f.family(); got != netfilter.ProtoUnspec {
+		t.Fatalf("family of an ID-only Flow = %v, want ProtoUnspec", got)
+	}
+}
+
+func TestFlowFamilyFromTupleOrig(t *testing.T) {
+	f := NewFlow(0, 0, net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), 1, 2, 30, 0)
+
+	if got := f.family(); got != netfilter.ProtoIPv6 {
+		t.Fatalf("family of an IPv6 Flow = %v, want ProtoIPv6", got)
+	}
+}
@@ -0,0 +1,268 @@
+package conntrack
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/netlink"
+	"github.com/ti-mo/netfilter"
+)
+
+// EventType describes the kind of Conntrack update a FlowEvent carries,
+// taken from the message type of the underlying Netlink event.
+type EventType uint8
+
+// Event types emitted over the Flow event subscription.
+const (
+	EventNew EventType = iota
+	EventUpdate
+	EventDestroy
+)
+
+// FlowEvent pairs an incoming Conntrack event with the previously observed
+// state of the Flow it concerns, letting callers reason about state
+// transitions instead of bare snapshots.
+//
+// Old is the zero Flow for EventNew events with no prior observation.
+type FlowEvent struct {
+	Type EventType
+	Old  Flow
+	New  Flow
+}
+
+// Changed returns the StatusFlag bits present on New that were not present
+// on Old.
+func (e FlowEvent) Changed() StatusFlag {
+	return (e.Old.Status.Value ^ e.New.Status.Value) & e.New.Status.Value
+}
+
+// BytesDelta returns the number of bytes seen in each direction since the
+// previous observation of the flow, derived from CountersOrig/CountersReply.
+func (e FlowEvent) BytesDelta() (orig, reply uint64) {
+	return e.New.CountersOrig.Bytes - e.Old.CountersOrig.Bytes,
+		e.New.CountersReply.Bytes - e.Old.CountersReply.Bytes
+}
+
+// DurationDelta returns how much longer the connection has been alive since
+// the previous observation, derived from the flows' Timestamp fields.
+func (e FlowEvent) DurationDelta() time.Duration {
+	return e.New.Timestamp.Duration() - e.Old.Timestamp.Duration()
+}
+
+// EventConfig configures the in-memory index Conn.Listen uses to look up
+// the previous state of a Flow when pairing it into a FlowEvent.
+type EventConfig struct {
+	// MaxEntries bounds the number of Flows held in the index. Zero means
+	// unbounded. Once reached, the least recently seen entry is evicted.
+	MaxEntries int
+
+	// DisableIndex turns off differential tracking entirely. Every event is
+	// delivered as a FlowEvent with a zero Old Flow, which avoids the
+	// memory overhead of the index on memory-constrained callers. Type
+	// classification is unaffected, as it is derived from the netlink
+	// header rather than the index.
+	DisableIndex bool
+}
+
+// flowIndexKey identifies a Flow in the event index, preferring the
+// kernel-assigned CTAID and falling back to (Zone, TupleOrig) when absent.
+type flowIndexKey struct {
+	id   uint32
+	zone uint16
+	key  string
+}
+
+func newFlowIndexKey(f Flow) flowIndexKey {
+	if f.ID != 0 {
+		return flowIndexKey{id: f.ID}
+	}
+
+	return flowIndexKey{
+		zone: f.Zone,
+		key: fmt.Sprintf("%s:%d-%s:%d-%d",
+			f.TupleOrig.IP.SourceAddress, f.TupleOrig.Proto.SourcePort,
+			f.TupleOrig.IP.DestinationAddress, f.TupleOrig.Proto.DestinationPort,
+			f.TupleOrig.Proto.Protocol),
+	}
+}
+
+// flowIndex is a bounded, least-recently-seen index of Flow snapshots keyed
+// by flowIndexKey, used to populate FlowEvent.Old.
+type flowIndex struct {
+	mu  sync.Mutex
+	max int
+
+	ll    *list.List
+	items map[flowIndexKey]*list.Element
+}
+
+type flowIndexEntry struct {
+	key  flowIndexKey
+	flow Flow
+}
+
+func newFlowIndex(max int) *flowIndex {
+	return &flowIndex{
+		max:   max,
+		ll:    list.New(),
+		items: make(map[flowIndexKey]*list.Element),
+	}
+}
+
+// get returns the last-seen Flow for key, if any.
+func (fi *flowIndex) get(key flowIndexKey) (Flow, bool) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	el, ok := fi.items[key]
+	if !ok {
+		return Flow{}, false
+	}
+
+	fi.ll.MoveToFront(el)
+
+	return el.Value.(*flowIndexEntry).flow, true
+}
+
+// put stores f under key, evicting the least recently seen entry if the
+// index is at capacity.
+func (fi *flowIndex) put(key flowIndexKey, f Flow) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	if el, ok := fi.items[key]; ok {
+		el.Value.(*flowIndexEntry).flow = f
+		fi.ll.MoveToFront(el)
+		return
+	}
+
+	el := fi.ll.PushFront(&flowIndexEntry{key: key, flow: f})
+	fi.items[key] = el
+
+	if fi.max > 0 && fi.ll.Len() > fi.max {
+		oldest := fi.ll.Back()
+		if oldest != nil {
+			fi.ll.Remove(oldest)
+			delete(fi.items, oldest.Value.(*flowIndexEntry).key)
+		}
+	}
+}
+
+// delete removes key from the index, e.g. once its Flow has been destroyed.
+func (fi *flowIndex) delete(key flowIndexKey) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	if el, ok := fi.items[key]; ok {
+		fi.ll.Remove(el)
+		delete(fi.items, key)
+	}
+}
+
+// classifyEventType derives an EventType from a netlink event's message type
+// and header flags. The kernel only gives DESTROY its own message type; NEW
+// and UPDATE both arrive as IPCTNL_MSG_CT_NEW and are told apart by the
+// NLM_F_CREATE flag, set only for genuinely new entries.
+func classifyEventType(msgType netfilter.MessageType, flags netlink.HeaderFlags) EventType {
+	switch msgType {
+	case netfilter.MessageType(IPCTNL_MSG_CT_NEW):
+		if flags&netlink.Create != 0 {
+			return EventNew
+		}
+		return EventUpdate
+	case netfilter.MessageType(IPCTNL_MSG_CT_DELETE):
+		return EventDestroy
+	default:
+		return EventUpdate
+	}
+}
+
+// Listen joins the Conntrack multicast groups and streams differential
+// FlowEvents to evCh until stop is closed. Each NEW/UPDATE event is paired
+// with the last-seen state of the Flow via an in-memory index configured
+// by cfg; DESTROY events clear the corresponding index entry.
+//
+// The returned channel carries a single error if the event stream ended
+// because of something other than stop being closed, e.g. the underlying
+// Netlink connection failing; it is closed without a value on a clean
+// shutdown.
+func (c *Conn) Listen(cfg EventConfig, evCh chan<- FlowEvent, stop <-chan struct{}) (<-chan error, error) {
+
+	if err := c.conn.JoinGroup(netfilter.NFNLGRPCTNew); err != nil {
+		return nil, err
+	}
+	if err := c.conn.JoinGroup(netfilter.NFNLGRPCTUpdate); err != nil {
+		return nil, err
+	}
+	if err := c.conn.JoinGroup(netfilter.NFNLGRPCTDestroy); err != nil {
+		return nil, err
+	}
+
+	var idx *flowIndex
+	if !cfg.DisableIndex {
+		idx = newFlowIndex(cfg.MaxEntries)
+	}
+
+	errCh := make(chan error, 1)
+
+	// Receive blocks indefinitely on an idle multicast group, so stop can
+	// only take effect by closing the connection out from under it.
+	go func() {
+		<-stop
+		c.conn.Close()
+	}()
+
+	go func() {
+		defer close(errCh)
+
+		for {
+			msgs, err := c.conn.Receive()
+			if err != nil {
+				select {
+				case <-stop:
+					// Receive was unblocked by the stop-triggered Close above.
+				default:
+					errCh <- err
+				}
+				return
+			}
+
+			for _, m := range msgs {
+
+				nfh, _, err := netfilter.UnmarshalNetlink(m)
+				if err != nil {
+					continue
+				}
+
+				f, err := unmarshalFlow(m)
+				if err != nil {
+					continue
+				}
+
+				ev := FlowEvent{New: f, Type: classifyEventType(nfh.MessageType, m.Header.Flags)}
+
+				if idx != nil {
+					key := newFlowIndexKey(f)
+
+					if ev.Type == EventDestroy {
+						if old, ok := idx.get(key); ok {
+							ev.Old = old
+						}
+						idx.delete(key)
+					} else {
+						if old, ok := idx.get(key); ok {
+							ev.Old = old
+						}
+						idx.put(key, f)
+					}
+				}
+
+				evCh <- ev
+			}
+		}
+	}()
+
+	return errCh, nil
+}
@@ -0,0 +1,99 @@
+package conntrack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mdlayher/netlink"
+	"github.com/ti-mo/netfilter"
+)
+
+func TestClassifyEventType(t *testing.T) {
+	tests := []struct {
+		name    string
+		msgType uint8
+		flags   netlink.HeaderFlags
+		want    EventType
+	}{
+		{"new", IPCTNL_MSG_CT_NEW, netlink.Create, EventNew},
+		{"update", IPCTNL_MSG_CT_NEW, 0, EventUpdate},
+		{"destroy", IPCTNL_MSG_CT_DELETE, 0, EventDestroy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyEventType(netfilter.MessageType(tt.msgType), tt.flags)
+			if got != tt.want {
+				t.Fatalf("classifyEventType(%d, %v) = %v, want %v", tt.msgType, tt.flags, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlowIndexGetPutDelete(t *testing.T) {
+	idx := newFlowIndex(0)
+
+	key := flowIndexKey{id: 1}
+
+	if _, ok := idx.get(key); ok {
+		t.Fatal("get on an empty index returned ok=true")
+	}
+
+	var f Flow
+	f.ID = 1
+	idx.put(key, f)
+
+	got, ok := idx.get(key)
+	if !ok || got.ID != 1 {
+		t.Fatalf("get after put = (%+v, %v), want (ID=1, true)", got, ok)
+	}
+
+	idx.delete(key)
+	if _, ok := idx.get(key); ok {
+		t.Fatal("get after delete returned ok=true")
+	}
+}
+
+func TestFlowIndexEviction(t *testing.T) {
+	idx := newFlowIndex(1)
+
+	idx.put(flowIndexKey{id: 1}, Flow{ID: 1})
+	idx.put(flowIndexKey{id: 2}, Flow{ID: 2})
+
+	if _, ok := idx.get(flowIndexKey{id: 1}); ok {
+		t.Fatal("oldest entry was not evicted once max was exceeded")
+	}
+	if _, ok := idx.get(flowIndexKey{id: 2}); !ok {
+		t.Fatal("most recently put entry is missing after eviction")
+	}
+}
+
+func TestFlowEventHelpers(t *testing.T) {
+	e := FlowEvent{
+		Old: Flow{
+			Status:        Status{Value: 1},
+			CountersOrig:  Counter{Bytes: 100},
+			CountersReply: Counter{Bytes: 50},
+		},
+		New: Flow{
+			Status:        Status{Value: 3},
+			CountersOrig:  Counter{Bytes: 150},
+			CountersReply: Counter{Bytes: 80},
+		},
+	}
+
+	if got, want := e.Changed(), StatusFlag(2); got != want {
+		t.Fatalf("Changed() = %d, want %d", got, want)
+	}
+
+	orig, reply := e.BytesDelta()
+	if orig != 50 || reply != 30 {
+		t.Fatalf("BytesDelta() = (%d, %d), want (50, 30)", orig, reply)
+	}
+
+	// Old and New start out with zero-value Timestamps, so the delta between
+	// them must be zero.
+	if got, want := e.DurationDelta(), time.Duration(0); got != want {
+		t.Fatalf("DurationDelta() on zero-value Timestamps = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,364 @@
+package conntrack
+
+import (
+	"fmt"
+
+	"github.com/mdlayher/netlink"
+
+	"github.com/ti-mo/netfilter"
+)
+
+// Expect represents a Conntrack expectation: a rule pre-authorizing a
+// related flow that a helper (e.g. FTP, SIP, H.323) expects to see shortly
+// after its master connection, before the related packets themselves
+// arrive.
+type Expect struct {
+	ID uint32
+
+	Master Tuple
+	Tuple  Tuple
+	Mask   Tuple
+
+	Timeout uint32
+
+	HelpName string
+
+	Flags uint32
+	Class uint32
+
+	NAT ExpectNAT
+
+	Zone uint16
+}
+
+// ExpectNAT describes the NAT tuple and direction an Expect should apply
+// to the related flow it authorizes.
+type ExpectNAT struct {
+	Dir   uint8
+	Tuple Tuple
+}
+
+// unmarshal unmarshals a list of netfilter.Attributes into an Expect structure.
+func (e *Expect) unmarshal(attrs []netfilter.Attribute) error {
+
+	for _, attr := range attrs {
+
+		switch at := AttributeType(attr.Type); at {
+
+		// CTA_EXPECT_MASTER is the tuple of the connection that spawned the expectation.
+		case CTAExpectMaster:
+			if err := e.Master.UnmarshalAttribute(attr); err != nil {
+				return err
+			}
+		// CTA_EXPECT_TUPLE is the tuple describing the expected related connection.
+		case CTAExpectTuple:
+			if err := e.Tuple.UnmarshalAttribute(attr); err != nil {
+				return err
+			}
+		// CTA_EXPECT_MASK is applied against CTA_EXPECT_TUPLE to determine which
+		// fields of an incoming connection must match to satisfy the expectation.
+		case CTAExpectMask:
+			if err := e.Mask.UnmarshalAttribute(attr); err != nil {
+				return err
+			}
+		// CTA_EXPECT_TIMEOUT is the time until the expectation is automatically removed.
+		case CTAExpectTimeout:
+			e.Timeout = attr.Uint32()
+		// CTA_EXPECT_ID is the kernel-assigned identifier of the expectation.
+		case CTAExpectID:
+			e.ID = attr.Uint32()
+		// CTA_EXPECT_HELP_NAME is the name of the helper that installed the expectation.
+		case CTAExpectHelpName:
+			e.HelpName = string(attr.Data)
+		// CTA_EXPECT_ZONE is the Conntrack zone the expectation is placed in.
+		case CTAExpectZone:
+			e.Zone = attr.Uint16()
+		// CTA_EXPECT_FLAGS carries NF_CT_EXPECT_* flags.
+		case CTAExpectFlags:
+			e.Flags = attr.Uint32()
+		// CTA_EXPECT_CLASS is the helper-defined expectation class, used by
+		// helpers that track more than one kind of related connection (e.g. SIP).
+		case CTAExpectClass:
+			e.Class = attr.Uint32()
+		// CTA_EXPECT_NAT is nested and carries the NAT direction and tuple to
+		// apply to the related connection once it arrives.
+		case CTAExpectNAT:
+			if err := e.NAT.UnmarshalAttribute(attr); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf(errAttributeUnknown, at)
+		}
+	}
+
+	return nil
+}
+
+// marshal marshals an Expect object into a list of netfilter.Attributes.
+func (e Expect) marshal() ([]netfilter.Attribute, error) {
+
+	if !e.Master.Filled() || !e.Tuple.Filled() {
+		return nil, errNeedTuples
+	}
+
+	attrs := make([]netfilter.Attribute, 0, 8)
+
+	mt, err := e.Master.MarshalAttribute(CTAExpectMaster)
+	if err != nil {
+		return nil, err
+	}
+	attrs = append(attrs, mt)
+
+	tt, err := e.Tuple.MarshalAttribute(CTAExpectTuple)
+	if err != nil {
+		return nil, err
+	}
+	attrs = append(attrs, tt)
+
+	if e.Mask.Filled() {
+		mk, err := e.Mask.MarshalAttribute(CTAExpectMask)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, mk)
+	}
+
+	if e.Timeout != 0 {
+		attrs = append(attrs, Num32{Value: e.Timeout}.MarshalAttribute(CTAExpectTimeout))
+	}
+
+	if e.HelpName != "" {
+		attrs = append(attrs, netfilter.Attribute{Type: uint16(CTAExpectHelpName), Data: []byte(e.HelpName)})
+	}
+
+	if e.Zone != 0 {
+		attrs = append(attrs, Num16{Value: e.Zone}.MarshalAttribute(CTAExpectZone))
+	}
+
+	if e.Flags != 0 {
+		attrs = append(attrs, Num32{Value: e.Flags}.MarshalAttribute(CTAExpectFlags))
+	}
+
+	if e.Class != 0 {
+		attrs = append(attrs, Num32{Value: e.Class}.MarshalAttribute(CTAExpectClass))
+	}
+
+	if e.NAT.Tuple.Filled() {
+		nat, err := e.NAT.MarshalAttribute()
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, nat)
+	}
+
+	return attrs, nil
+}
+
+// MarshalAttribute marshals an ExpectNAT into a CTA_EXPECT_NAT nested netfilter.Attribute.
+func (en ExpectNAT) MarshalAttribute() (netfilter.Attribute, error) {
+
+	nt, err := en.Tuple.MarshalAttribute(CTAExpectNATTuple)
+	if err != nil {
+		return netfilter.Attribute{}, err
+	}
+
+	return netfilter.Attribute{
+		Type:   uint16(CTAExpectNAT),
+		Nested: true,
+		Children: []netfilter.Attribute{
+			Num32{Value: uint32(en.Dir)}.MarshalAttribute(CTAExpectNATDir),
+			nt,
+		},
+	}, nil
+}
+
+// UnmarshalAttribute unmarshals a CTA_EXPECT_NAT nested netfilter.Attribute into an ExpectNAT.
+func (en *ExpectNAT) UnmarshalAttribute(attr netfilter.Attribute) error {
+
+	if AttributeType(attr.Type) != CTAExpectNAT {
+		return fmt.Errorf(errAttributeWrongType, attr.Type, CTAExpectNAT)
+	}
+
+	for _, child := range attr.Children {
+		switch AttributeType(child.Type) {
+		case CTAExpectNATDir:
+			en.Dir = uint8(child.Uint32())
+		case CTAExpectNATTuple:
+			if err := en.Tuple.UnmarshalAttribute(child); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf(errAttributeUnknown, AttributeType(child.Type))
+		}
+	}
+
+	return nil
+}
+
+// unmarshalExpect unmarshals an Expect from a netlink.Message.
+// The Message must contain valid attributes.
+func unmarshalExpect(nlm netlink.Message) (Expect, error) {
+
+	var e Expect
+
+	_, qattrs, err := netfilter.UnmarshalNetlink(nlm)
+	if err != nil {
+		return e, err
+	}
+
+	err = e.unmarshal(qattrs)
+	if err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+// unmarshalExpects unmarshals a list of expectations from a list of Netlink messages.
+// This method can be used to parse the result of a dump query.
+func unmarshalExpects(nlm []netlink.Message) ([]Expect, error) {
+
+	out := make([]Expect, 0, len(nlm))
+
+	for i := 0; i < len(nlm); i++ {
+
+		e, err := unmarshalExpect(nlm[i])
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, e)
+	}
+
+	return out, nil
+}
+
+// CreateExpect sends a request to the kernel to install a new Conntrack
+// expectation. NLM_F_CREATE and NLM_F_EXCL are set on the request, so the
+// kernel rejects it with EEXIST if a matching expectation already exists.
+//
+// e must have both Master and Tuple filled in.
+func (c *Conn) CreateExpect(e Expect) error {
+
+	attrs, err := e.marshal()
+	if err != nil {
+		return err
+	}
+
+	nfh := netfilter.Header{
+		Family:      e.Master.family(),
+		SubsystemID: netfilter.NFSubsysCTNetlinkExp,
+		MessageType: netfilter.MessageType(IPCTNL_MSG_EXP_NEW),
+		Flags:       netlink.Request | netlink.Create | netlink.Excl | netlink.Acknowledge,
+	}
+
+	_, err = c.query(nfh, attrs)
+
+	return err
+}
+
+// DeleteExpect sends a request to the kernel to remove the Conntrack
+// expectation matching e's Tuple.
+func (c *Conn) DeleteExpect(e Expect) error {
+
+	attrs, err := e.marshal()
+	if err != nil {
+		return err
+	}
+
+	nfh := netfilter.Header{
+		Family:      e.Master.family(),
+		SubsystemID: netfilter.NFSubsysCTNetlinkExp,
+		MessageType: netfilter.MessageType(IPCTNL_MSG_EXP_DELETE),
+		Flags:       netlink.Request | netlink.Acknowledge,
+	}
+
+	_, err = c.query(nfh, attrs)
+
+	return err
+}
+
+// DumpExpect returns all Conntrack expectations currently installed in the kernel.
+func (c *Conn) DumpExpect() ([]Expect, error) {
+
+	nfh := netfilter.Header{
+		SubsystemID: netfilter.NFSubsysCTNetlinkExp,
+		MessageType: netfilter.MessageType(IPCTNL_MSG_EXP_GET),
+		Flags:       netlink.Request | netlink.Dump,
+	}
+
+	nlm, err := c.query(nfh, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return unmarshalExpects(nlm)
+}
+
+// FlushExpect removes all Conntrack expectations installed in the kernel.
+func (c *Conn) FlushExpect() error {
+
+	nfh := netfilter.Header{
+		SubsystemID: netfilter.NFSubsysCTNetlinkExp,
+		MessageType: netfilter.MessageType(IPCTNL_MSG_EXP_DELETE),
+		Flags:       netlink.Request | netlink.Acknowledge,
+	}
+
+	_, err := c.query(nfh, nil)
+
+	return err
+}
+
+// ListenExpect joins the NFNL_SUBSYS_CTNETLINK_EXP multicast groups and
+// streams decoded Expect events to evCh until stop is closed. It is the
+// expectation-subsystem counterpart of the Flow event subscription.
+//
+// The returned channel carries a single error if the event stream ended
+// because of something other than stop being closed, e.g. the underlying
+// Netlink connection failing; it is closed without a value on a clean
+// shutdown.
+func (c *Conn) ListenExpect(evCh chan<- Expect, stop <-chan struct{}) (<-chan error, error) {
+
+	if err := c.conn.JoinGroup(netfilter.NFNLGRPCTExpNew); err != nil {
+		return nil, err
+	}
+	if err := c.conn.JoinGroup(netfilter.NFNLGRPCTExpDestroy); err != nil {
+		return nil, err
+	}
+
+	errCh := make(chan error, 1)
+
+	// Receive blocks indefinitely on an idle multicast group, so stop can
+	// only take effect by closing the connection out from under it.
+	go func() {
+		<-stop
+		c.conn.Close()
+	}()
+
+	go func() {
+		defer close(errCh)
+
+		for {
+			msgs, err := c.conn.Receive()
+			if err != nil {
+				select {
+				case <-stop:
+					// Receive was unblocked by the stop-triggered Close above.
+				default:
+					errCh <- err
+				}
+				return
+			}
+
+			for _, m := range msgs {
+				e, err := unmarshalExpect(m)
+				if err != nil {
+					continue
+				}
+				evCh <- e
+			}
+		}
+	}()
+
+	return errCh, nil
+}
@@ -0,0 +1,56 @@
+//go:build integration
+
+package conntrack
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// TestHelperHandoffToExpect drives the pattern a userspace ALG would use:
+// create a Flow with a Helper installed on it, then inject an Expect for
+// the related connection the helper is about to see. It needs CAP_NET_ADMIN
+// to dial the Conntrack netlink socket, so it's skipped outside of root and
+// gated behind the integration build tag like the rest of this package's
+// kernel-touching tests.
+func TestHelperHandoffToExpect(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("test requires root to dial the Conntrack netlink socket")
+	}
+
+	c, err := Dial(nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer c.Close()
+
+	master := NewFlow(
+		unix.IPPROTO_TCP, 0,
+		net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"),
+		21, 4000,
+		30, 0,
+	)
+	master.Helper = Helper{Name: "ftp"}
+
+	if err := c.Create(master); err != nil {
+		t.Fatalf("Create master Flow: %v", err)
+	}
+
+	e := Expect{
+		Master:   master.TupleOrig,
+		Tuple:    tuple(net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.1"), 2121, 21),
+		HelpName: "ftp",
+		Timeout:  30,
+	}
+
+	if err := c.CreateExpect(e); err != nil {
+		t.Fatalf("CreateExpect for the master's related connection: %v", err)
+	}
+
+	if err := c.FlushExpect(); err != nil {
+		t.Fatalf("FlushExpect cleanup: %v", err)
+	}
+}
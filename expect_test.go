@@ -0,0 +1,77 @@
+package conntrack
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func tuple(src, dst net.IP, srcPort, dstPort uint16) Tuple {
+	var tp Tuple
+	tp.IP.SourceAddress = src
+	tp.IP.DestinationAddress = dst
+	tp.Proto.SourcePort = srcPort
+	tp.Proto.DestinationPort = dstPort
+	tp.Proto.Protocol = 6
+	return tp
+}
+
+func TestExpectMarshalRequiresMasterAndTuple(t *testing.T) {
+	var e Expect
+
+	if _, err := e.marshal(); !errors.Is(err, errNeedTuples) {
+		t.Fatalf("marshal of an empty Expect = %v, want errNeedTuples", err)
+	}
+
+	e.Master = tuple(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 1, 21)
+
+	if _, err := e.marshal(); !errors.Is(err, errNeedTuples) {
+		t.Fatalf("marshal with only Master set = %v, want errNeedTuples", err)
+	}
+}
+
+func TestExpectMarshalUnmarshal(t *testing.T) {
+	e := Expect{
+		Master:   tuple(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 1, 21),
+		Tuple:    tuple(net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.1"), 2121, 1),
+		HelpName: "ftp",
+		Timeout:  300,
+	}
+
+	attrs, err := e.marshal()
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	var got Expect
+	if err := got.unmarshal(attrs); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if got.HelpName != e.HelpName || got.Timeout != e.Timeout {
+		t.Fatalf("round-trip mismatch: got %+v, want HelpName=%q Timeout=%d", got, e.HelpName, e.Timeout)
+	}
+}
+
+func TestExpectNATMarshalUnmarshal(t *testing.T) {
+	// A filled NAT tuple marshals without error, and the nested
+	// CTA_EXPECT_NAT attribute unmarshals back to the same direction.
+	en := ExpectNAT{
+		Dir:   1,
+		Tuple: tuple(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 1, 21),
+	}
+
+	attr, err := en.MarshalAttribute()
+	if err != nil {
+		t.Fatalf("MarshalAttribute: %v", err)
+	}
+
+	var got ExpectNAT
+	if err := got.UnmarshalAttribute(attr); err != nil {
+		t.Fatalf("UnmarshalAttribute: %v", err)
+	}
+
+	if got.Dir != en.Dir {
+		t.Fatalf("Dir round-trip = %d, want %d", got.Dir, en.Dir)
+	}
+}
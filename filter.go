@@ -0,0 +1,179 @@
+package conntrack
+
+import (
+	"errors"
+
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/ti-mo/netfilter"
+)
+
+// DumpFilter describes a kernel-side filter that can be attached to a dump
+// request so the kernel only returns Flows matching it, instead of the
+// caller dumping the full table and discarding unwanted entries in
+// userspace. All fields are optional; a zero-value DumpFilter matches
+// everything.
+type DumpFilter struct {
+	Mark *MarkFilter
+
+	Zone *uint16
+
+	Status *StatusFilter
+
+	// Family restricts the dump to AF_INET or AF_INET6 entries. Zero means
+	// both families are returned.
+	Family uint8
+
+	// Tuple is matched against a Flow's TupleOrig when set.
+	Tuple *Tuple
+
+	// TupleReply is matched against a Flow's TupleReply when set.
+	TupleReply *Tuple
+}
+
+// MarkFilter matches connections whose connmark, once ANDed with Mask,
+// equals Mark.
+type MarkFilter struct {
+	Mark uint32
+	Mask uint32
+}
+
+// StatusFilter matches connections whose status, once ANDed with Mask,
+// equals Status.
+type StatusFilter struct {
+	Status StatusFlag
+	Mask   StatusFlag
+}
+
+// marshal marshals a DumpFilter into a list of flat, top-level
+// netfilter.Attributes attached directly to the dump request. The
+// CTA_MARK/CTA_STATUS/CTA_ZONE/CTA_TUPLE_* attributes are sent individually
+// rather than through a nested container; CTA_FILTER is not used. Returns
+// nil, nil for a zero-value filter.
+func (f DumpFilter) marshal() ([]netfilter.Attribute, error) {
+
+	var attrs []netfilter.Attribute
+
+	if f.Mark != nil {
+		attrs = append(attrs,
+			Num32{Value: f.Mark.Mark}.MarshalAttribute(CTAMark),
+			Num32{Value: f.Mark.Mask}.MarshalAttribute(CTAMarkMask),
+		)
+	}
+
+	if f.Status != nil {
+		attrs = append(attrs,
+			f.Status.Status.MarshalAttribute(),
+			Num32{Value: uint32(f.Status.Mask)}.MarshalAttribute(CTAStatusMask),
+		)
+	}
+
+	if f.Zone != nil {
+		attrs = append(attrs, Num16{Value: *f.Zone}.MarshalAttribute(CTAZone))
+	}
+
+	if f.Tuple != nil {
+		tt, err := f.Tuple.MarshalAttribute(CTATupleOrig)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, tt)
+	}
+
+	if f.TupleReply != nil {
+		tr, err := f.TupleReply.MarshalAttribute(CTATupleReply)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, tr)
+	}
+
+	return attrs, nil
+}
+
+// marshalLegacy marshals the subset of a DumpFilter supported by kernels old
+// enough to reject one of marshal's newer predicate attributes with
+// EOPNOTSUPP: only CTA_MARK/CTA_MARK_MASK, ignoring Zone, Status and Tuple.
+// Family is still honored, as it is carried in the request header rather
+// than as an attribute.
+func (f DumpFilter) marshalLegacy() []netfilter.Attribute {
+
+	if f.Mark == nil {
+		return nil
+	}
+
+	return []netfilter.Attribute{
+		Num32{Value: f.Mark.Mark}.MarshalAttribute(CTAMark),
+		Num32{Value: f.Mark.Mask}.MarshalAttribute(CTAMarkMask),
+	}
+}
+
+// Dump returns all Flows currently tracked by the kernel.
+func (c *Conn) Dump() ([]Flow, error) {
+	return c.dump(nil)
+}
+
+// DumpFiltered returns the Flows tracked by the kernel matching filter.
+// It first attempts filter's full set of predicate attributes; if the
+// kernel responds with EOPNOTSUPP, it falls back to the legacy CTA_MARK/
+// CTA_MARK_MASK shortcut, which only supports filtering on the connmark.
+func (c *Conn) DumpFiltered(filter DumpFilter) ([]Flow, error) {
+
+	flows, err := c.dump(&filter)
+	if errors.Is(err, unix.EOPNOTSUPP) {
+		return c.dumpLegacy(filter)
+	}
+
+	return flows, err
+}
+
+// dump issues a dump request for the given filter, attaching filter's
+// predicate attributes directly to the request when filter is non-nil.
+func (c *Conn) dump(filter *DumpFilter) ([]Flow, error) {
+
+	var attrs []netfilter.Attribute
+
+	if filter != nil {
+		fa, err := filter.marshal()
+		if err != nil {
+			return nil, err
+		}
+		attrs = fa
+	}
+
+	nfh := netfilter.Header{
+		Family:      netfilter.ProtoUnspec,
+		MessageType: netfilter.MessageType(IPCTNL_MSG_CT_GET),
+		Flags:       netlink.Request | netlink.Dump,
+	}
+
+	if filter != nil {
+		nfh.Family = netfilter.ProtoFamily(filter.Family)
+	}
+
+	nlm, err := c.query(nfh, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	return unmarshalFlows(nlm)
+}
+
+// dumpLegacy issues a dump request using the pre-5.8 CTA_MARK/CTA_MARK_MASK
+// filter shortcut.
+func (c *Conn) dumpLegacy(filter DumpFilter) ([]Flow, error) {
+
+	nfh := netfilter.Header{
+		Family:      netfilter.ProtoFamily(filter.Family),
+		MessageType: netfilter.MessageType(IPCTNL_MSG_CT_GET),
+		Flags:       netlink.Request | netlink.Dump,
+	}
+
+	nlm, err := c.query(nfh, filter.marshalLegacy())
+	if err != nil {
+		return nil, err
+	}
+
+	return unmarshalFlows(nlm)
+}
@@ -0,0 +1,65 @@
+package conntrack
+
+import (
+	"net"
+	"testing"
+)
+
+func TestDumpFilterMarshalEmpty(t *testing.T) {
+	var f DumpFilter
+
+	attrs, err := f.marshal()
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if attrs != nil {
+		t.Fatalf("marshal of a zero-value DumpFilter = %+v, want nil", attrs)
+	}
+}
+
+func TestDumpFilterMarshalMarkZoneStatus(t *testing.T) {
+	zone := uint16(5)
+	f := DumpFilter{
+		Mark:   &MarkFilter{Mark: 0x1, Mask: 0xff},
+		Zone:   &zone,
+		Status: &StatusFilter{Status: 1, Mask: 1},
+	}
+
+	attrs, err := f.marshal()
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	// Mark+MarkMask, Status+StatusMask, Zone, as flat top-level attributes.
+	if got, want := len(attrs), 5; got != want {
+		t.Fatalf("marshal produced %d attributes, want %d", got, want)
+	}
+}
+
+func TestDumpFilterMarshalTupleOrigAndReply(t *testing.T) {
+	orig := tuple(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 1, 2)
+	reply := tuple(net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.1"), 2, 1)
+
+	f := DumpFilter{Tuple: &orig, TupleReply: &reply}
+
+	attrs, err := f.marshal()
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	if got, want := len(attrs), 2; got != want {
+		t.Fatalf("marshal produced %d attributes, want %d (orig + reply tuple)", got, want)
+	}
+}
+
+func TestDumpFilterMarshalLegacyIgnoresEverythingButMark(t *testing.T) {
+	f := DumpFilter{
+		Zone: new(uint16),
+		Mark: &MarkFilter{Mark: 0x1, Mask: 0xff},
+	}
+
+	attrs := f.marshalLegacy()
+	if got, want := len(attrs), 2; got != want {
+		t.Fatalf("marshalLegacy produced %d attributes, want %d (CTA_MARK + CTA_MARK_MASK)", got, want)
+	}
+}
@@ -1,10 +1,12 @@
 package conntrack
 
 import (
+	"errors"
 	"fmt"
 	"net"
 
 	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
 
 	"github.com/ti-mo/netfilter"
 )
@@ -69,6 +71,54 @@ func NewFlow(proto uint8, status StatusFlag, srcAddr, destAddr net.IP, srcPort,
 	return f
 }
 
+// NewTCPFlow returns a new Flow set up like NewFlow, with its ProtoInfo
+// populated so the kernel places the entry straight into TCPStateEstablished
+// instead of leaving it stuck in TCPStateSynSent. This is the common case
+// for seeding established TCP connections into Conntrack from tests or
+// migration tooling.
+func NewTCPFlow(status StatusFlag, srcAddr, destAddr net.IP, srcPort, destPort uint16, timeout, mark uint32) Flow {
+
+	f := NewFlow(unix.IPPROTO_TCP, status, srcAddr, destAddr, srcPort, destPort, timeout, mark)
+
+	seen := TCPFlags{Flags: tcpFlagsSeen, Mask: tcpFlagsSeen}
+	f.SetTCPState(TCPStateEstablished, seen, seen)
+
+	return f
+}
+
+// NewUDPFlow returns a new Flow set up like NewFlow, for UDP connections.
+// UDP has no CTA_PROTOINFO of its own, so this is a thin convenience
+// wrapper around NewFlow that fixes the protocol number.
+func NewUDPFlow(status StatusFlag, srcAddr, destAddr net.IP, srcPort, destPort uint16, timeout, mark uint32) Flow {
+	return NewFlow(unix.IPPROTO_UDP, status, srcAddr, destAddr, srcPort, destPort, timeout, mark)
+}
+
+// NewSCTPFlow returns a new Flow set up like NewFlow, for SCTP connections.
+func NewSCTPFlow(status StatusFlag, srcAddr, destAddr net.IP, srcPort, destPort uint16, timeout, mark uint32) Flow {
+	return NewFlow(unix.IPPROTO_SCTP, status, srcAddr, destAddr, srcPort, destPort, timeout, mark)
+}
+
+// tcpWScale is the window scale factor set by SetTCPState on both sides of
+// the connection. 7 matches the default advertised by recent Linux kernels.
+const tcpWScale = 7
+
+// tcpFlagsSeen marks both the window scale and SACK permitted options as
+// seen on the wire, which is what a fully established connection looks like
+// to the kernel's TCP tracker.
+const tcpFlagsSeen = 1<<0 | 1<<1
+
+// SetTCPState sets the Flow's CTA_PROTOINFO_TCP state and per-direction
+// seen-flags, and applies the default window scale factor used by
+// NewTCPFlow. Call this after NewFlow to turn a plain Flow into one the
+// kernel accepts as an established TCP connection.
+func (f *Flow) SetTCPState(state uint8, origFlags, replyFlags TCPFlags) {
+	f.ProtoInfo.TCP.State = state
+	f.ProtoInfo.TCP.FlagsOrig = origFlags
+	f.ProtoInfo.TCP.FlagsReply = replyFlags
+	f.ProtoInfo.TCP.WScaleOrig = tcpWScale
+	f.ProtoInfo.TCP.WScaleReply = tcpWScale
+}
+
 // unmarshal unmarshals a list of netfilter.Attributes into a Flow structure.
 func (f *Flow) unmarshal(attrs []netfilter.Attribute) error {
 
@@ -177,27 +227,70 @@ func (f *Flow) unmarshal(attrs []netfilter.Attribute) error {
 	return nil
 }
 
-// marshal marshals a Flow object into a list of netfilter.Attributes.
-func (f Flow) marshal() ([]netfilter.Attribute, error) {
+// errNeedIDOrTuple is returned by marshalUpdate when a Flow carries neither
+// a CTAID nor a filled TupleOrig, leaving the kernel nothing to key the
+// update on.
+var errNeedIDOrTuple = errors.New("flow must carry an ID or a TupleOrig to be updated")
+
+// marshalCreate marshals a Flow object into a list of netfilter.Attributes
+// suitable for an IPCTNL_MSG_CT_NEW request that creates a new Conntrack
+// entry. The kernel needs both directions of the connection to construct
+// the entry, so TupleOrig and TupleReply must both be filled.
+func (f Flow) marshalCreate() ([]netfilter.Attribute, error) {
 
 	// Each connection sent to the kernel should have at least an original and reply tuple.
 	if !f.TupleOrig.Filled() || !f.TupleReply.Filled() {
 		return nil, errNeedTuples
 	}
 
-	attrs := make([]netfilter.Attribute, 2, 12)
+	return f.marshalAttributes()
+}
 
-	to, err := f.TupleOrig.MarshalAttribute(CTATupleOrig)
-	if err != nil {
-		return nil, err
+// marshalUpdate marshals a Flow object into a list of netfilter.Attributes
+// suitable for an IPCTNL_MSG_CT_NEW request that updates an existing
+// Conntrack entry. The kernel only needs enough information to key the
+// existing record, so either a CTAID or TupleOrig alone is sufficient;
+// TupleReply is not required.
+func (f Flow) marshalUpdate() ([]netfilter.Attribute, error) {
+
+	if f.ID == 0 && !f.TupleOrig.Filled() {
+		return nil, errNeedIDOrTuple
 	}
-	attrs[0] = to
 
-	tr, err := f.TupleReply.MarshalAttribute(CTATupleReply)
-	if err != nil {
+	return f.marshalAttributes()
+}
+
+// marshalAttributes marshals the set of Flow attributes shared by
+// marshalCreate and marshalUpdate. TupleOrig and TupleReply are attached
+// whenever filled, since marshalCreate requires both and marshalUpdate
+// permits keying a Flow by CTAID alone.
+func (f Flow) marshalAttributes() ([]netfilter.Attribute, error) {
+
+	if err := f.ProtoInfo.Valid(); err != nil {
 		return nil, err
 	}
-	attrs[1] = tr
+
+	attrs := make([]netfilter.Attribute, 0, 13)
+
+	if f.TupleOrig.Filled() {
+		to, err := f.TupleOrig.MarshalAttribute(CTATupleOrig)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, to)
+	}
+
+	if f.TupleReply.Filled() {
+		tr, err := f.TupleReply.MarshalAttribute(CTATupleReply)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, tr)
+	}
+
+	if f.ID != 0 {
+		attrs = append(attrs, Num32{Value: f.ID}.MarshalAttribute(CTAID))
+	}
 
 	// Optional attributes appended to the list when filled
 	if f.Timeout != 0 {
@@ -216,6 +309,14 @@ func (f Flow) marshal() ([]netfilter.Attribute, error) {
 		attrs = append(attrs, Num16{Value: f.Zone}.MarshalAttribute(CTAZone))
 	}
 
+	if len(f.Labels) > 0 {
+		attrs = append(attrs, netfilter.Attribute{Type: uint16(CTALabels), Data: f.Labels})
+	}
+
+	if len(f.LabelsMask) > 0 {
+		attrs = append(attrs, netfilter.Attribute{Type: uint16(CTALabelsMask), Data: f.LabelsMask})
+	}
+
 	if f.ProtoInfo.Filled() {
 		attrs = append(attrs, f.ProtoInfo.MarshalAttribute())
 	}
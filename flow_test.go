@@ -0,0 +1,113 @@
+package conntrack
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestFlowMarshalCreateRequiresBothTuples(t *testing.T) {
+	f := NewFlow(0, 0, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 1, 2, 30, 0)
+
+	// Clearing TupleReply leaves Create without a full picture of the
+	// connection, which the kernel needs to construct a new entry.
+	f.TupleReply = Tuple{}
+
+	if _, err := f.marshalCreate(); !errors.Is(err, errNeedTuples) {
+		t.Fatalf("marshalCreate with a missing TupleReply = %v, want errNeedTuples", err)
+	}
+}
+
+func TestFlowMarshalUpdateByID(t *testing.T) {
+	var f Flow
+	f.ID = 42
+
+	attrs, err := f.marshalUpdate()
+	if err != nil {
+		t.Fatalf("marshalUpdate with only ID set: %v", err)
+	}
+
+	if len(attrs) != 1 {
+		t.Fatalf("marshalUpdate with only ID set produced %d attributes, want 1 (CTAID)", len(attrs))
+	}
+}
+
+func TestFlowMarshalUpdateByTupleOrig(t *testing.T) {
+	f := NewFlow(0, 0, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 1, 2, 30, 0)
+	f.TupleReply = Tuple{}
+
+	if _, err := f.marshalUpdate(); err != nil {
+		t.Fatalf("marshalUpdate with only TupleOrig set: %v", err)
+	}
+}
+
+func TestFlowMarshalUpdateNeedsIDOrTuple(t *testing.T) {
+	var f Flow
+
+	if _, err := f.marshalUpdate(); !errors.Is(err, errNeedIDOrTuple) {
+		t.Fatalf("marshalUpdate with neither ID nor TupleOrig = %v, want errNeedIDOrTuple", err)
+	}
+}
+
+// TestFlowCreateMutateUpdateRoundTrip mimics the lifecycle of a Flow as a
+// caller would drive it: build one with NewFlow, marshal it for Create,
+// then mutate Mark/Labels/Timeout as if reacting to a later observation and
+// marshal it again for Update by ID. Both marshaled attribute sets must
+// unmarshal back into Flows carrying the values they were given.
+func TestFlowCreateMutateUpdateRoundTrip(t *testing.T) {
+	f := NewFlow(unix.IPPROTO_TCP, 0, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 1, 2, 30, 0x1)
+
+	createAttrs, err := f.marshalCreate()
+	if err != nil {
+		t.Fatalf("marshalCreate: %v", err)
+	}
+
+	var created Flow
+	if err := created.unmarshal(createAttrs); err != nil {
+		t.Fatalf("unmarshal of marshalCreate's attributes: %v", err)
+	}
+
+	if created.Mark != 0x1 || created.Timeout != 30 {
+		t.Fatalf("created Flow = %+v, want Mark=0x1 Timeout=30", created)
+	}
+
+	// Mutate as if the caller is pushing a later observation: new mark,
+	// new labels, a refreshed timeout. Key the update by ID alone, as a
+	// caller re-observing an existing kernel entry would.
+	f.ID = 7
+	f.Mark = 0x2
+	f.Labels = []byte{0xff, 0x00}
+	f.Timeout = 60
+
+	updateAttrs, err := f.marshalUpdate()
+	if err != nil {
+		t.Fatalf("marshalUpdate: %v", err)
+	}
+
+	var updated Flow
+	if err := updated.unmarshal(updateAttrs); err != nil {
+		t.Fatalf("unmarshal of marshalUpdate's attributes: %v", err)
+	}
+
+	if updated.ID != 7 || updated.Mark != 0x2 || updated.Timeout != 60 {
+		t.Fatalf("updated Flow = %+v, want ID=7 Mark=0x2 Timeout=60", updated)
+	}
+	if string(updated.Labels) != string(f.Labels) {
+		t.Fatalf("updated Flow Labels = %v, want %v", updated.Labels, f.Labels)
+	}
+}
+
+func TestNewTCPFlowEstablished(t *testing.T) {
+	f := NewTCPFlow(0, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 1, 2, 30, 0)
+
+	if f.ProtoInfo.TCP.State != TCPStateEstablished {
+		t.Fatalf("NewTCPFlow state = %d, want TCPStateEstablished", f.ProtoInfo.TCP.State)
+	}
+
+	if f.ProtoInfo.TCP.WScaleOrig != tcpWScale || f.ProtoInfo.TCP.WScaleReply != tcpWScale {
+		t.Fatalf("NewTCPFlow window scale = (%d, %d), want (%d, %d)",
+			f.ProtoInfo.TCP.WScaleOrig, f.ProtoInfo.TCP.WScaleReply, tcpWScale, tcpWScale)
+	}
+}
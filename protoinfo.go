@@ -0,0 +1,207 @@
+package conntrack
+
+import (
+	"fmt"
+
+	"github.com/ti-mo/netfilter"
+)
+
+// ProtoInfo carries protocol-specific Conntrack metadata. Only one of TCP,
+// DCCP or SCTP is ever set, matching the protocol of the Flow it belongs to.
+type ProtoInfo struct {
+	TCP  ProtoInfoTCP
+	DCCP ProtoInfoDCCP
+	SCTP ProtoInfoSCTP
+}
+
+// ProtoInfoTCP carries the CTA_PROTOINFO_TCP attributes the kernel uses to
+// track TCP's state machine. Without it, entries injected by userspace are
+// left stuck in SYN_SENT.
+type ProtoInfoTCP struct {
+	State uint8
+
+	WScaleOrig, WScaleReply uint8
+
+	FlagsOrig, FlagsReply TCPFlags
+}
+
+// TCPFlags mirrors struct nf_ct_tcp_flags: Flags is the seen-flags bitfield
+// and Mask selects which of those bits the kernel should actually apply.
+// CTA_PROTOINFO_TCP_FLAGS_ORIGINAL/REPLY are always exactly these two bytes;
+// the kernel rejects anything else with -ERANGE.
+type TCPFlags struct {
+	Flags uint8
+	Mask  uint8
+}
+
+// ProtoInfoDCCP carries the CTA_PROTOINFO_DCCP attributes. HandshakeSeq is
+// only meaningful while the connection is mid-handshake (REQUEST/RESPOND)
+// and is zero otherwise.
+type ProtoInfoDCCP struct {
+	State, Role uint8
+
+	HandshakeSeq uint64
+}
+
+// ProtoInfoSCTP carries the CTA_PROTOINFO_SCTP attributes.
+type ProtoInfoSCTP struct {
+	State uint8
+
+	VTagOrig, VTagReply uint32
+}
+
+// TCP conntrack states, mirroring enum tcp_conntrack in
+// include/uapi/linux/netfilter/nf_conntrack_tcp.h.
+const (
+	TCPStateNone uint8 = iota
+	TCPStateSynSent
+	TCPStateSynRecv
+	TCPStateEstablished
+	TCPStateFinWait
+	TCPStateCloseWait
+	TCPStateLastAck
+	TCPStateTimeWait
+	TCPStateClose
+)
+
+// Filled returns true if any of the protocol-specific sub-structures carry
+// a non-zero state, meaning the ProtoInfo should be marshaled.
+func (pi ProtoInfo) Filled() bool {
+	return pi.TCP.State != 0 || pi.DCCP.State != 0 || pi.SCTP.State != 0
+}
+
+// Valid returns an error if more than one protocol-specific sub-structure
+// is populated, since the kernel only ever sends (and accepts) one.
+func (pi ProtoInfo) Valid() error {
+
+	set := 0
+	if pi.TCP.State != 0 {
+		set++
+	}
+	if pi.DCCP.State != 0 {
+		set++
+	}
+	if pi.SCTP.State != 0 {
+		set++
+	}
+
+	if set > 1 {
+		return errProtoInfoMultiple
+	}
+
+	return nil
+}
+
+// errProtoInfoMultiple is returned by ProtoInfo.Valid when more than one of
+// TCP, DCCP or SCTP is populated at once.
+var errProtoInfoMultiple = fmt.Errorf("protoinfo: only one of TCP, DCCP or SCTP may be set")
+
+// MarshalAttribute marshals a ProtoInfo into a CTA_PROTOINFO nested netfilter.Attribute.
+func (pi ProtoInfo) MarshalAttribute() netfilter.Attribute {
+
+	var children []netfilter.Attribute
+
+	if pi.TCP.State != 0 {
+		children = append(children, netfilter.Attribute{
+			Type:   uint16(CTAProtoInfoTCP),
+			Nested: true,
+			Children: []netfilter.Attribute{
+				{Type: uint16(CTAProtoInfoTCPState), Data: []byte{pi.TCP.State}},
+				{Type: uint16(CTAProtoInfoTCPWScaleOrig), Data: []byte{pi.TCP.WScaleOrig}},
+				{Type: uint16(CTAProtoInfoTCPWScaleReply), Data: []byte{pi.TCP.WScaleReply}},
+				{Type: uint16(CTAProtoInfoTCPFlagsOrig), Data: []byte{pi.TCP.FlagsOrig.Flags, pi.TCP.FlagsOrig.Mask}},
+				{Type: uint16(CTAProtoInfoTCPFlagsReply), Data: []byte{pi.TCP.FlagsReply.Flags, pi.TCP.FlagsReply.Mask}},
+			},
+		})
+	}
+
+	if pi.DCCP.State != 0 {
+		children = append(children, netfilter.Attribute{
+			Type:   uint16(CTAProtoInfoDCCP),
+			Nested: true,
+			Children: []netfilter.Attribute{
+				{Type: uint16(CTAProtoInfoDCCPState), Data: []byte{pi.DCCP.State}},
+				{Type: uint16(CTAProtoInfoDCCPRole), Data: []byte{pi.DCCP.Role}},
+				Num64{Value: pi.DCCP.HandshakeSeq}.MarshalAttribute(CTAProtoInfoDCCPHandshakeSeq),
+			},
+		})
+	}
+
+	if pi.SCTP.State != 0 {
+		children = append(children, netfilter.Attribute{
+			Type:   uint16(CTAProtoInfoSCTP),
+			Nested: true,
+			Children: []netfilter.Attribute{
+				{Type: uint16(CTAProtoInfoSCTPState), Data: []byte{pi.SCTP.State}},
+				Num32{Value: pi.SCTP.VTagOrig}.MarshalAttribute(CTAProtoInfoSCTPVTagOrig),
+				Num32{Value: pi.SCTP.VTagReply}.MarshalAttribute(CTAProtoInfoSCTPVTagReply),
+			},
+		})
+	}
+
+	return netfilter.Attribute{
+		Type:     uint16(CTAProtoInfo),
+		Nested:   true,
+		Children: children,
+	}
+}
+
+// UnmarshalAttribute unmarshals a CTA_PROTOINFO nested netfilter.Attribute into a ProtoInfo.
+func (pi *ProtoInfo) UnmarshalAttribute(attr netfilter.Attribute) error {
+
+	if AttributeType(attr.Type) != CTAProtoInfo {
+		return fmt.Errorf(errAttributeWrongType, attr.Type, CTAProtoInfo)
+	}
+
+	for _, child := range attr.Children {
+		switch AttributeType(child.Type) {
+		case CTAProtoInfoTCP:
+			for _, tc := range child.Children {
+				switch AttributeType(tc.Type) {
+				case CTAProtoInfoTCPState:
+					pi.TCP.State = tc.Data[0]
+				case CTAProtoInfoTCPWScaleOrig:
+					pi.TCP.WScaleOrig = tc.Data[0]
+				case CTAProtoInfoTCPWScaleReply:
+					pi.TCP.WScaleReply = tc.Data[0]
+				case CTAProtoInfoTCPFlagsOrig:
+					pi.TCP.FlagsOrig = TCPFlags{Flags: tc.Data[0], Mask: tc.Data[1]}
+				case CTAProtoInfoTCPFlagsReply:
+					pi.TCP.FlagsReply = TCPFlags{Flags: tc.Data[0], Mask: tc.Data[1]}
+				default:
+					return fmt.Errorf(errAttributeUnknown, AttributeType(tc.Type))
+				}
+			}
+		case CTAProtoInfoDCCP:
+			for _, dc := range child.Children {
+				switch AttributeType(dc.Type) {
+				case CTAProtoInfoDCCPState:
+					pi.DCCP.State = dc.Data[0]
+				case CTAProtoInfoDCCPRole:
+					pi.DCCP.Role = dc.Data[0]
+				case CTAProtoInfoDCCPHandshakeSeq:
+					pi.DCCP.HandshakeSeq = dc.Uint64()
+				default:
+					return fmt.Errorf(errAttributeUnknown, AttributeType(dc.Type))
+				}
+			}
+		case CTAProtoInfoSCTP:
+			for _, sc := range child.Children {
+				switch AttributeType(sc.Type) {
+				case CTAProtoInfoSCTPState:
+					pi.SCTP.State = sc.Data[0]
+				case CTAProtoInfoSCTPVTagOrig:
+					pi.SCTP.VTagOrig = sc.Uint32()
+				case CTAProtoInfoSCTPVTagReply:
+					pi.SCTP.VTagReply = sc.Uint32()
+				default:
+					return fmt.Errorf(errAttributeUnknown, AttributeType(sc.Type))
+				}
+			}
+		default:
+			return fmt.Errorf(errAttributeUnknown, AttributeType(child.Type))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package conntrack
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestProtoInfoValidRejectsMultiple(t *testing.T) {
+	pi := ProtoInfo{
+		TCP:  ProtoInfoTCP{State: TCPStateEstablished},
+		DCCP: ProtoInfoDCCP{State: 1},
+	}
+
+	if err := pi.Valid(); !errors.Is(err, errProtoInfoMultiple) {
+		t.Fatalf("Valid() with both TCP and DCCP set = %v, want errProtoInfoMultiple", err)
+	}
+}
+
+func TestProtoInfoTCPRoundTrip(t *testing.T) {
+	pi := ProtoInfo{
+		TCP: ProtoInfoTCP{
+			State:       TCPStateEstablished,
+			WScaleOrig:  7,
+			WScaleReply: 7,
+			FlagsOrig:   TCPFlags{Flags: 3, Mask: 3},
+			FlagsReply:  TCPFlags{Flags: 3, Mask: 3},
+		},
+	}
+
+	var got ProtoInfo
+	if err := got.UnmarshalAttribute(pi.MarshalAttribute()); err != nil {
+		t.Fatalf("UnmarshalAttribute: %v", err)
+	}
+
+	if got.TCP != pi.TCP {
+		t.Fatalf("TCP round-trip = %+v, want %+v", got.TCP, pi.TCP)
+	}
+}
+
+func TestProtoInfoDCCPRoundTrip(t *testing.T) {
+	pi := ProtoInfo{DCCP: ProtoInfoDCCP{State: 4, Role: 1, HandshakeSeq: 0x1122334455667788}}
+
+	var got ProtoInfo
+	if err := got.UnmarshalAttribute(pi.MarshalAttribute()); err != nil {
+		t.Fatalf("UnmarshalAttribute: %v", err)
+	}
+
+	if got.DCCP != pi.DCCP {
+		t.Fatalf("DCCP round-trip = %+v, want %+v", got.DCCP, pi.DCCP)
+	}
+}
+
+func TestProtoInfoSCTPRoundTrip(t *testing.T) {
+	pi := ProtoInfo{SCTP: ProtoInfoSCTP{State: 2, VTagOrig: 0xdeadbeef, VTagReply: 0xfeedface}}
+
+	var got ProtoInfo
+	if err := got.UnmarshalAttribute(pi.MarshalAttribute()); err != nil {
+		t.Fatalf("UnmarshalAttribute: %v", err)
+	}
+
+	if got.SCTP != pi.SCTP {
+		t.Fatalf("SCTP round-trip = %+v, want %+v", got.SCTP, pi.SCTP)
+	}
+}